@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printDiff prints a minimal diff of the change replacer made to path, for
+// -diff. Lines are matched with a plain longest-common-subsequence rather
+// than a Myers-style diff with hunks and context; that's simpler and is
+// fine for the modestly sized previews this flag is meant for.
+func printDiff(path, before, after string) {
+	fmt.Printf("--- %s\n+++ %s\n", path, path)
+
+	for _, line := range diffLines(splitLines(before), splitLines(after)) {
+		fmt.Println(line)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns a and b diffed line-by-line, each line prefixed with
+// "  " (unchanged), "- " (removed), or "+ " (added).
+func diffLines(a, b []string) []string {
+	n, m := len(a), len(b)
+
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+
+	for ; i < n; i++ {
+		out = append(out, "- "+a[i])
+	}
+
+	for ; j < m; j++ {
+		out = append(out, "+ "+b[j])
+	}
+
+	return out
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/afero"
+)
+
+// newFS returns the afero.Fs backend selected by -scheme, along with the
+// root path walkDir should start from (schemes that sandbox the tree
+// rewrite the root relative to their own Fs).
+//
+// "os" (the default) operates directly on the host filesystem. "mem" is
+// an in-memory filesystem, mainly useful for tests since it starts empty.
+// "basepath" restricts every operation to paths under rootPath, so a
+// symlink or ".." in a matched path can't escape the tree being edited.
+func newFS(scheme, rootPath string) (fs afero.Fs, walkRoot string, err error) {
+	switch scheme {
+	case "", "os":
+		return afero.NewOsFs(), rootPath, nil
+	case "mem":
+		return afero.NewMemMapFs(), rootPath, nil
+	case "basepath":
+		return afero.NewBasePathFs(afero.NewOsFs(), rootPath), ".", nil
+	default:
+		return nil, "", fmt.Errorf("unknown -scheme %q: want os, mem, or basepath", scheme)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestNewFS(t *testing.T) {
+	tests := []struct {
+		name         string
+		scheme       string
+		wantWalkRoot string
+		expectError  bool
+	}{
+		{name: "default", scheme: "", wantWalkRoot: "/tmp/root"},
+		{name: "os", scheme: "os", wantWalkRoot: "/tmp/root"},
+		{name: "mem", scheme: "mem", wantWalkRoot: "/tmp/root"},
+		{name: "basepath", scheme: "basepath", wantWalkRoot: "."},
+		{name: "unknown", scheme: "tar", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, walkRoot, err := newFS(tt.scheme, "/tmp/root")
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected an error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if fs == nil {
+				t.Fatal("expected a non-nil Fs")
+			}
+
+			if walkRoot != tt.wantWalkRoot {
+				t.Errorf("expected walk root %q but got %q", tt.wantWalkRoot, walkRoot)
+			}
+		})
+	}
+}
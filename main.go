@@ -14,39 +14,129 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/spf13/afero"
 )
 
 const (
 	maxFileSize = 2 * 1024 * 1024 * 1024
+
+	// readBlockSize is how much of a large file replaceInLargeFile reads
+	// into its rolling buffer at a time.
+	readBlockSize = 64 * 1024
 )
 
 var (
-	timeout = flag.Duration("timeout", 3*time.Minute, "timeout")
+	timeout          = flag.Duration("timeout", 3*time.Minute, "timeout")
+	useRegex         = flag.Bool("regex", false, "treat search as a Go regexp; replace may use $1/${name} capture-group expansion")
+	patternsFile     = flag.String("patterns", "", "path to a file of tab-separated search\\treplace pairs, applied together in a single pass")
+	scheme           = flag.String("scheme", "os", "filesystem backend to use: os, mem, or basepath")
+	dryRun           = flag.Bool("dry-run", false, "report which files would change without modifying them")
+	backupSuffix     = flag.String("backup", "", "if set, back up each modified file to path+suffix (e.g. -backup=.bak) before rewriting it")
+	showDiff         = flag.Bool("diff", false, "print a diff of each file's changes")
+	reportFormat     = flag.String("report", "", "emit a summary report when done: json or text")
+	reportFile       = flag.String("report-file", "", "write the -report summary here instead of stdout")
+	followSymlinks   = flag.Bool("follow-symlinks", false, "follow symlinks to files and directories instead of skipping them")
+	maxDepth         = flag.Int("max-depth", -1, "only descend this many directories below the root (-1 means unlimited, 0 means root-level files only)")
+	respectGitignore = flag.Bool("respect-gitignore", false, "skip files and directories matched by .gitignore files found while walking")
+	matchBinary      = flag.Bool("binary", false, "also process files that look binary (their first 8 KiB contains a NUL byte)")
+
+	includes stringList
+	excludes stringList
 )
 
+func init() {
+	flag.Var(&includes, "include", "only process paths matching this glob, relative to the root (repeatable)")
+	flag.Var(&excludes, "exclude", "skip paths matching this glob, relative to the root (repeatable)")
+}
+
+// stringList implements flag.Value so a flag like -include can be repeated,
+// collecting every occurrence instead of keeping only the last.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// writeOptions controls how (or whether) a matched file is written back to
+// disk, threaded through the worker pool so every file in a run is handled
+// the same way.
+type writeOptions struct {
+	dryRun bool
+	backup string
+	diff   bool
+}
+
 func main() {
-	if len(os.Args) != 4 {
-		fmt.Println("Usage: replacer <search> <replace> <path>")
+	flag.Parse()
+
+	var (
+		pairs    [][2]string
+		rootPath string
+	)
+
+	if *patternsFile != "" {
+		if flag.NArg() != 1 {
+			fmt.Println("Usage: replacer -patterns <file> <path>")
+			return
+		}
+
+		var err error
+		pairs, err = loadPatterns(*patternsFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		rootPath = flag.Arg(0)
+	} else {
+		if flag.NArg() != 3 {
+			fmt.Println("Usage: replacer <search> <replace> <path>")
+			return
+		}
+
+		pairs = [][2]string{{flag.Arg(0), flag.Arg(1)}}
+		rootPath = flag.Arg(2)
+	}
+
+	replacer, err := NewReplacer(pairs, *useRegex)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fs, walkRoot, err := newFS(*scheme, rootPath)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
+	opts := writeOptions{
+		dryRun: *dryRun,
+		backup: *backupSuffix,
+		diff:   *showDiff,
+	}
+
+	selector := NewSelector(includes, excludes, *followSymlinks, *maxDepth, *respectGitignore, *matchBinary)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 
 	ctx, cancel = context.WithTimeout(ctx, *timeout)
 	defer cancel()
 
-	search := os.Args[1]
-	replace := os.Args[2]
-	rootPath := os.Args[3]
-
 	workers := runtime.GOMAXPROCS(0)
 	largeFiles := make(chan string, workers)
 	smallFiles := make(chan string, workers)
-	errs := make([]error, 0)
+	report := &Report{}
 
 	go func() {
-		err := walk(ctx, rootPath, largeFiles, smallFiles, errs)
+		err := walk(ctx, fs, walkRoot, largeFiles, smallFiles, report, selector)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -62,15 +152,14 @@ func main() {
 				log.Printf("Processing %s", path)
 				select {
 				case <-ctx.Done():
-					errs = append(errs, ctx.Err())
+					report.addError(path, ctx.Err())
 					return
 				default:
 				}
 
-				err := replaceInFile(path, search, replace)
-				if err != nil {
-					errs = append(errs, err)
-				}
+				start := time.Now()
+				bytesScanned, replacements, err := replaceInFile(fs, path, replacer, opts)
+				report.add(resultFor(path, bytesScanned, replacements, 0, start, err))
 			}
 		}()
 	}
@@ -83,37 +172,84 @@ func main() {
 				log.Printf("Processing %s", path)
 				select {
 				case <-ctx.Done():
-					errs = append(errs, ctx.Err())
+					report.addError(path, ctx.Err())
 					return
 				default:
 				}
 
-				err := replaceInLargeFile(ctx, path, search, replace)
-				if err != nil {
-					errs = append(errs, err)
-				}
+				start := time.Now()
+				bytesScanned, replacements, uncertain, err := replaceInLargeFile(ctx, fs, path, replacer, opts)
+				report.add(resultFor(path, bytesScanned, replacements, uncertain, start, err))
 			}
 		}()
 	}
 
 	wg.Wait()
 
-	for _, err := range errs {
-		fmt.Println(err)
+	summary := report.summary()
+
+	if *reportFormat != "" {
+		out := io.Writer(os.Stdout)
+
+		if *reportFile != "" {
+			f, err := os.Create(*reportFile)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				defer f.Close()
+				out = f
+			}
+		}
+
+		if err := summary.write(out, *reportFormat); err != nil {
+			fmt.Println(err)
+		}
+	} else {
+		for _, res := range summary.Results {
+			if res.Error != "" {
+				fmt.Println(res.Error)
+			}
+		}
+	}
+
+	if summary.FilesErrored > 0 {
+		os.Exit(1)
 	}
 
 	os.Exit(0)
 }
 
+// resultFor builds the FileResult for a file processed since start.
+// uncertain is nonzero only for files streamed through replaceInLargeFile
+// where a regex match was resolved right at a block boundary and may have
+// been cut short (see regexOverlapWindow).
+func resultFor(path string, bytesScanned int64, replacements, uncertain int, start time.Time, err error) FileResult {
+	res := FileResult{
+		Path:             path,
+		BytesScanned:     bytesScanned,
+		Replacements:     replacements,
+		UncertainMatches: uncertain,
+		Duration:         time.Since(start),
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
 // walk wraps walkDir and closes the channels when the walk is done.
 func walk(
 	ctx context.Context,
-	path string,
+	fs afero.Fs,
+	root string,
 	largeFiles,
 	smallFiles chan string,
-	errs []error,
+	report *Report,
+	selector *Selector,
 ) error {
-	err := walkDir(ctx, path, largeFiles, smallFiles, errs)
+	err := walkDir(ctx, fs, root, root, 0, largeFiles, smallFiles, report, selector)
 
 	close(largeFiles)
 	close(smallFiles)
@@ -121,111 +257,332 @@ func walk(
 	return err
 }
 
-// walkDir walks the directory tree rooted at path and sends the paths of large
-// files to largeFiles and the paths of small files to smallFiles.
+// walkDir walks the directory tree rooted at dir (depth directories below
+// root) and sends the paths of large files to largeFiles and the paths of
+// small files to smallFiles. selector decides which entries are skipped:
+// -include/-exclude globs, -max-depth, .gitignore rules picked up along the
+// way, -follow-symlinks, and binary-file detection.
 func walkDir(
 	ctx context.Context,
-	path string,
+	fs afero.Fs,
+	root, dir string,
+	depth int,
 	largeFiles,
 	smallFiles chan string,
-	errs []error,
+	report *Report,
+	selector *Selector,
 ) error {
-	initialPath := path
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if err := selector.EnterDir(fs, dir, relToRoot(root, dir)); err != nil {
+		report.addError(dir, err)
+		return nil
+	}
+	defer selector.LeaveDir()
 
-	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		report.addError(dir, err)
+		return nil
+	}
+
+	for _, info := range entries {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		if path == initialPath {
-			return nil
-		}
+		path := filepath.Join(dir, info.Name())
+		rel := relToRoot(root, path)
 
-		log.Printf("Walking %s", path)
+		if info.Mode()&os.ModeSymlink != 0 {
+			if selector.SkipSymlink() {
+				continue
+			}
 
-		if err != nil {
-			errs = append(errs, err)
-			return nil
+			target, err := fs.Stat(path)
+			if err != nil {
+				report.addError(path, err)
+				continue
+			}
+
+			info = target
 		}
 
 		if info.IsDir() {
-			err := walkDir(ctx, path, largeFiles, smallFiles, errs)
+			if selector.TooDeep(depth+1) || !selector.ShouldDescend(rel) {
+				continue
+			}
+
+			if err := walkDir(ctx, fs, root, path, depth+1, largeFiles, smallFiles, report, selector); err != nil {
+				report.addError(path, err)
+			}
+
+			continue
+		}
+
+		if !selector.Matches(rel, false) {
+			continue
+		}
+
+		if !selector.allowBinary {
+			bin, err := isBinary(fs, path)
 			if err != nil {
-				errs = append(errs, err)
+				report.addError(path, err)
+				continue
 			}
 
-			return nil
+			if bin {
+				continue
+			}
 		}
 
+		log.Printf("Walking %s", path)
+
 		if info.Size() > maxFileSize {
 			largeFiles <- path
-			return nil
+		} else {
+			smallFiles <- path
 		}
+	}
+
+	return nil
+}
 
-		smallFiles <- path
+// relToRoot returns path's slash-separated path relative to root, or "" if
+// path is root itself.
+func relToRoot(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return ""
+	}
 
-		return nil
-	})
+	return filepath.ToSlash(rel)
 }
 
-func replaceInFile(path, search, replace string) error {
-	input, err := os.OpenFile(path, os.O_RDWR, 0644)
+func replaceInFile(fs afero.Fs, path string, replacer *Replacer, opts writeOptions) (bytesScanned int64, replacements int, err error) {
+	info, err := fs.Stat(path)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	defer input.Close()
+	input, err := fs.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
 
 	b, err := io.ReadAll(input)
+	input.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bytesScanned = int64(len(b))
+
+	output, replacements := replacer.ReplaceCount(string(b))
+	if output == string(b) {
+		return bytesScanned, 0, nil
+	}
+
+	if opts.diff {
+		printDiff(path, string(b), output)
+	}
+
+	if opts.dryRun {
+		log.Printf("dry-run: %s would change", path)
+		return bytesScanned, replacements, nil
+	}
+
+	tempFile, err := afero.TempFile(fs, filepath.Dir(path), "replacer")
 	if err != nil {
+		return bytesScanned, replacements, err
+	}
+	defer fs.Remove(tempFile.Name())
+
+	if _, err := tempFile.WriteString(output); err != nil {
+		tempFile.Close()
+		return bytesScanned, replacements, err
+	}
+
+	return bytesScanned, replacements, finishWrite(fs, tempFile, path, info, opts)
+}
+
+// finishWrite fsyncs tempFile, copies path's original permissions (and,
+// where the platform exposes it, ownership) onto it, optionally backs up
+// the original file, then atomically renames tempFile over path. tempFile
+// must already hold the file's full new content and live in the same
+// directory as path, so the rename can't cross a filesystem boundary.
+//
+// Mode and ownership preservation are best-effort: a file you can write to
+// but don't own (e.g. one in a sticky or world-writable directory) fails
+// Chown with EPERM even though rewriting its content is allowed, and
+// failing the whole edit over that would be a regression from the
+// pre-atomic-write behavior of just overwriting the file in place. So a
+// Chmod/Chown error is logged and otherwise ignored rather than aborting
+// the rename.
+func finishWrite(fs afero.Fs, tempFile afero.File, path string, info os.FileInfo, opts writeOptions) error {
+	tempPath := tempFile.Name()
+
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
 		return err
 	}
 
-	output := strings.ReplaceAll(string(b), search, replace)
+	if err := fs.Chmod(tempPath, info.Mode()); err != nil {
+		log.Printf("warning: %s: preserving file mode: %v", path, err)
+	}
+
+	if uid, gid, ok := fileOwner(info); ok {
+		if err := fs.Chown(tempPath, uid, gid); err != nil {
+			log.Printf("warning: %s: preserving file owner: %v", path, err)
+		}
+	}
+
+	if opts.backup != "" {
+		if err := copyFile(fs, path, path+opts.backup, info.Mode()); err != nil {
+			return err
+		}
+	}
 
-	return os.WriteFile(path, []byte(output), 0644)
+	return fs.Rename(tempPath, path)
 }
 
-func replaceInLargeFile(ctx context.Context, path, search, replace string) error {
-	inputFile, err := os.Open(path)
+// copyFile copies src to dst on fs, used to write a -backup copy of a file
+// before it is overwritten.
+func copyFile(fs afero.Fs, src, dst string, mode os.FileMode) error {
+	data, err := afero.ReadFile(fs, src)
 	if err != nil {
 		return err
 	}
-	defer inputFile.Close()
 
-	tempFile, err := os.CreateTemp("", "replacer")
+	return afero.WriteFile(fs, dst, data, mode)
+}
+
+// printFileDiff prints a diff between the file at origPath and the
+// rewritten content at tempPath, reading both back from fs rather than
+// keeping the new content in memory, since replaceInLargeFile streams
+// files too big to hold in memory in one piece.
+func printFileDiff(fs afero.Fs, origPath, tempPath string) error {
+	orig, err := afero.ReadFile(fs, origPath)
+	if err != nil {
+		return err
+	}
+
+	updated, err := afero.ReadFile(fs, tempPath)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tempFile.Name())
+
+	printDiff(origPath, string(orig), string(updated))
+
+	return nil
+}
+
+// replaceInLargeFile streams path through replacer in fixed-size blocks
+// instead of loading it whole, so files too big to hold in memory can still
+// be rewritten. Content is copied byte-for-byte apart from the matched
+// spans: original line endings (or their absence) are preserved, and a
+// match straddling a block boundary is held back and resolved once the
+// following block arrives rather than being silently missed. uncertain
+// reports how many resolved matches replacer.chunk flagged as possibly cut
+// short at a block boundary (see regexOverlapWindow); callers surface this
+// to the user rather than treating the file as cleanly processed.
+//
+// A "^" or "$" anchored pattern is rejected outright rather than attempted:
+// unlike the uncertain-match case, an anchor mismatch happens at every
+// block boundary, not just an unlucky one, so there's no meaningful count
+// to surface and no way to get a correct result from this streaming path.
+func replaceInLargeFile(ctx context.Context, fs afero.Fs, path string, replacer *Replacer, opts writeOptions) (bytesScanned int64, replacements, uncertain int, err error) {
+	if replacer.unsafeForLargeFiles() {
+		return 0, 0, 0, fmt.Errorf("%s: too large to stream with a \"^\" or \"$\" anchored pattern (over %d bytes)", path, maxFileSize)
+	}
+
+	info, err := fs.Stat(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	bytesScanned = info.Size()
+
+	inputFile, err := fs.Open(path)
+	if err != nil {
+		return bytesScanned, 0, 0, err
+	}
+	defer inputFile.Close()
+
+	tempFile, err := afero.TempFile(fs, filepath.Dir(path), "replacer")
+	if err != nil {
+		return bytesScanned, 0, 0, err
+	}
+	defer fs.Remove(tempFile.Name())
 
 	writer := bufio.NewWriter(tempFile)
-	scanner := bufio.NewScanner(inputFile)
+	reader := bufio.NewReaderSize(inputFile, readBlockSize)
+
+	var pending []byte
+	block := make([]byte, readBlockSize)
 
-	for scanner.Scan() {
+	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return bytesScanned, replacements, uncertain, ctx.Err()
 		default:
 		}
 
-		line := scanner.Text()
-		newLine := strings.ReplaceAll(line, search, replace)
-		_, err := writer.WriteString(newLine + "\n")
-		if err != nil {
-			return err
+		n, readErr := reader.Read(block)
+		if n > 0 {
+			pending = append(pending, block[:n]...)
+		}
+
+		if readErr != nil && readErr != io.EOF {
+			return bytesScanned, replacements, uncertain, readErr
+		}
+
+		atEOF := readErr == io.EOF
+
+		flush, rest, n2, u2 := replacer.chunk(pending, atEOF)
+		replacements += n2
+		uncertain += u2
+		if _, err := writer.Write(flush); err != nil {
+			return bytesScanned, replacements, uncertain, err
+		}
+		pending = rest
+
+		if atEOF {
+			break
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return err
+	if err := writer.Flush(); err != nil {
+		return bytesScanned, replacements, uncertain, err
+	}
+
+	if replacements == 0 {
+		tempFile.Close()
+		return bytesScanned, 0, uncertain, nil
 	}
 
-	writer.Flush()
-	tempFile.Close()
-	inputFile.Close()
+	if opts.diff {
+		if err := printFileDiff(fs, path, tempFile.Name()); err != nil {
+			tempFile.Close()
+			return bytesScanned, replacements, uncertain, err
+		}
+	}
+
+	if opts.dryRun {
+		log.Printf("dry-run: %s would change", path)
+		tempFile.Close()
+		return bytesScanned, replacements, uncertain, nil
+	}
 
-	return os.Rename(tempFile.Name(), path)
+	return bytesScanned, replacements, uncertain, finishWrite(fs, tempFile, path, info, opts)
 }
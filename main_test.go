@@ -6,37 +6,41 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/spf13/afero"
 )
 
 func TestReplaceInLargeFile(t *testing.T) {
 	tests := []struct {
-		name        string
-		content     string
-		search      string
-		replace     string
-		expected    string
-		expectError bool
+		name          string
+		content       string
+		search        string
+		replace       string
+		useRegex      bool
+		expected      string
+		expectError   bool
+		wantUncertain int
 	}{
 		{
 			name:     "simple replacement",
 			content:  "hello world",
 			search:   "world",
 			replace:  "gopher",
-			expected: "hello gopher\n",
+			expected: "hello gopher",
 		},
 		{
 			name:     "multiple replacements",
 			content:  "foo bar foo",
 			search:   "foo",
 			replace:  "baz",
-			expected: "baz bar baz\n",
+			expected: "baz bar baz",
 		},
 		{
 			name:     "no match",
 			content:  "hello world",
 			search:   "gopher",
 			replace:  "world",
-			expected: "hello world\n",
+			expected: "hello world",
 		},
 		{
 			name:     "empty content",
@@ -61,21 +65,54 @@ func TestReplaceInLargeFile(t *testing.T) {
 			expected:    buildLargeFile("b", 1024*1024),
 			expectError: false,
 		},
+		{
+			name:     "match straddles a block boundary",
+			content:  strings.Repeat("x", readBlockSize-3) + "foobar" + strings.Repeat("x", 10),
+			search:   "foobar",
+			replace:  "REPLACED",
+			expected: strings.Repeat("x", readBlockSize-3) + "REPLACED" + strings.Repeat("x", 10),
+		},
+		{
+			// A run of "a"s longer than regexOverlapWindow straddling a
+			// block boundary is beyond what the fixed-size overlap window
+			// can hold back: the first block's greedy match is resolved
+			// right at the block's edge, and the remaining run in the
+			// next block is matched again as a second, separate match.
+			// This is the documented limitation on regexOverlapWindow;
+			// the test pins down the known behavior and checks it's
+			// surfaced via the uncertain count rather than silently wrong.
+			name:          "unbounded regex match straddling a block boundary is flagged",
+			content:       "START" + strings.Repeat("a", readBlockSize+5000) + "END",
+			search:        "a+",
+			replace:       "FILLED",
+			useRegex:      true,
+			expected:      "STARTFILLEDFILLEDEND",
+			wantUncertain: 1,
+		},
+		{
+			name:     "crlf line endings preserved",
+			content:  "hello world\r\nfoo bar\r\n",
+			search:   "world",
+			replace:  "gopher",
+			expected: "hello gopher\r\nfoo bar\r\n",
+		},
+		{
+			name:     "no trailing newline preserved",
+			content:  "hello world",
+			search:   "hello",
+			replace:  "goodbye",
+			expected: "goodbye world",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a temporary file with the test content
-			tempFile, err := os.CreateTemp("", "testfile")
-			if err != nil {
-				t.Fatalf("failed to create temp file: %v", err)
-			}
-			defer os.Remove(tempFile.Name())
+			fs := afero.NewMemMapFs()
 
-			if _, err := tempFile.WriteString(tt.content); err != nil {
-				t.Fatalf("failed to write to temp file: %v", err)
+			const path = "/testfile"
+			if err := afero.WriteFile(fs, path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
 			}
-			tempFile.Close()
 
 			// Set up context
 			var ctx context.Context
@@ -88,7 +125,12 @@ func TestReplaceInLargeFile(t *testing.T) {
 			defer cancel()
 
 			// Call the function
-			err = replaceInLargeFile(ctx, tempFile.Name(), tt.search, tt.replace)
+			replacer, err := NewReplacer([][2]string{{tt.search, tt.replace}}, tt.useRegex)
+			if err != nil {
+				t.Fatalf("failed to build replacer: %v", err)
+			}
+
+			_, _, uncertain, err := replaceInLargeFile(ctx, fs, path, replacer, writeOptions{})
 
 			// Check for expected errors
 			if tt.expectError {
@@ -100,10 +142,14 @@ func TestReplaceInLargeFile(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
+			if uncertain != tt.wantUncertain {
+				t.Errorf("uncertain = %d, want %d", uncertain, tt.wantUncertain)
+			}
+
 			// Read the file content back
-			result, err := os.ReadFile(tempFile.Name())
+			result, err := afero.ReadFile(fs, path)
 			if err != nil {
-				t.Fatalf("failed to read temp file: %v", err)
+				t.Fatalf("failed to read test file: %v", err)
 			}
 
 			// Compare the result with the expected output
@@ -114,6 +160,24 @@ func TestReplaceInLargeFile(t *testing.T) {
 	}
 }
 
+func TestReplaceInLargeFileRejectsAnchoredRegex(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	const path = "/testfile"
+	if err := afero.WriteFile(fs, path, []byte(buildLargeFile("a", readBlockSize*2)), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	replacer, err := NewReplacer([][2]string{{"^a+", "b"}}, true)
+	if err != nil {
+		t.Fatalf("failed to build replacer: %v", err)
+	}
+
+	if _, _, _, err := replaceInLargeFile(context.Background(), fs, path, replacer, writeOptions{}); err == nil {
+		t.Fatal("expected an error for a pattern anchored with ^ on the large-file path")
+	}
+}
+
 func TestReplaceInFile(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -155,20 +219,20 @@ func TestReplaceInFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a temporary file with the test content
-			tempFile, err := os.CreateTemp("", "testfile")
-			if err != nil {
-				t.Fatalf("failed to create temp file: %v", err)
-			}
-			defer os.Remove(tempFile.Name())
+			fs := afero.NewMemMapFs()
 
-			if _, err := tempFile.WriteString(tt.content); err != nil {
-				t.Fatalf("failed to write to temp file: %v", err)
+			const path = "/testfile"
+			if err := afero.WriteFile(fs, path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
 			}
-			tempFile.Close()
 
 			// Call the function
-			err = replaceInFile(tempFile.Name(), tt.search, tt.replace)
+			replacer, err := NewReplacer([][2]string{{tt.search, tt.replace}}, false)
+			if err != nil {
+				t.Fatalf("failed to build replacer: %v", err)
+			}
+
+			_, _, err = replaceInFile(fs, path, replacer, writeOptions{})
 
 			// Check for unexpected errors
 			if tt.expectError {
@@ -181,9 +245,9 @@ func TestReplaceInFile(t *testing.T) {
 			}
 
 			// Read the file content back
-			result, err := os.ReadFile(tempFile.Name())
+			result, err := afero.ReadFile(fs, path)
 			if err != nil {
-				t.Fatalf("failed to read temp file: %v", err)
+				t.Fatalf("failed to read test file: %v", err)
 			}
 
 			// Compare the result with the expected output
@@ -194,6 +258,149 @@ func TestReplaceInFile(t *testing.T) {
 	}
 }
 
+func TestReplaceInFileDryRun(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	const path = "/testfile"
+	if err := afero.WriteFile(fs, path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	replacer, err := NewReplacer([][2]string{{"world", "gopher"}}, false)
+	if err != nil {
+		t.Fatalf("failed to build replacer: %v", err)
+	}
+
+	if _, _, err := replaceInFile(fs, path, replacer, writeOptions{dryRun: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := afero.ReadFile(fs, path)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	if string(result) != "hello world" {
+		t.Errorf("dry-run should not modify the file, got %q", string(result))
+	}
+}
+
+func TestReplaceInFileBackup(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	const path = "/testfile"
+	if err := afero.WriteFile(fs, path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	replacer, err := NewReplacer([][2]string{{"world", "gopher"}}, false)
+	if err != nil {
+		t.Fatalf("failed to build replacer: %v", err)
+	}
+
+	if _, _, err := replaceInFile(fs, path, replacer, writeOptions{backup: ".bak"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := afero.ReadFile(fs, path)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	if string(result) != "hello gopher" {
+		t.Errorf("expected %q but got %q", "hello gopher", string(result))
+	}
+
+	backup, err := afero.ReadFile(fs, path+".bak")
+	if err != nil {
+		t.Fatalf("failed to read backup file: %v", err)
+	}
+	if string(backup) != "hello world" {
+		t.Errorf("expected backup %q but got %q", "hello world", string(backup))
+	}
+}
+
+func TestReplaceInFilePreservesContentOnChmodChownError(t *testing.T) {
+	fs := &chmodChownFailingFs{Fs: afero.NewMemMapFs()}
+
+	const path = "/testfile"
+	if err := afero.WriteFile(fs, path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	replacer, err := NewReplacer([][2]string{{"world", "gopher"}}, false)
+	if err != nil {
+		t.Fatalf("failed to build replacer: %v", err)
+	}
+
+	if _, _, err := replaceInFile(fs, path, replacer, writeOptions{}); err != nil {
+		t.Fatalf("a Chmod/Chown failure should not abort the write, got: %v", err)
+	}
+
+	result, err := afero.ReadFile(fs, path)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	if string(result) != "hello gopher" {
+		t.Errorf("expected %q but got %q", "hello gopher", string(result))
+	}
+}
+
+// chmodChownFailingFs wraps an afero.Fs to simulate a file you can write
+// to but don't own, e.g. one in a sticky or world-writable directory:
+// Chmod and Chown fail with EPERM the way they would on a real OS fs.
+type chmodChownFailingFs struct {
+	afero.Fs
+}
+
+func (f *chmodChownFailingFs) Chmod(name string, mode os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (f *chmodChownFailingFs) Chown(name string, uid, gid int) error {
+	return os.ErrPermission
+}
+
+func TestWalkIncludeRecursesIntoNonMatchingDirs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(fs, "/root/main.go", []byte("package main"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/root/pkg/sub/nested.go", []byte("package sub"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/root/pkg/sub/README.md", []byte("docs"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	selector := NewSelector([]string{"*.go"}, nil, false, -1, false, true)
+	report := &Report{}
+	largeFiles := make(chan string, 10)
+	smallFiles := make(chan string, 10)
+
+	if err := walk(context.Background(), fs, "/root", largeFiles, smallFiles, report, selector); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	var found []string
+	for path := range smallFiles {
+		found = append(found, path)
+	}
+	for path := range largeFiles {
+		found = append(found, path)
+	}
+
+	want := map[string]bool{"/root/main.go": true, "/root/pkg/sub/nested.go": true}
+	if len(found) != len(want) {
+		t.Fatalf("got files %v, want %v", found, want)
+	}
+	for _, path := range found {
+		if !want[path] {
+			t.Errorf("unexpected file walked: %s", path)
+		}
+	}
+}
+
 func buildLargeFile(char string, size int) string {
 	var sb strings.Builder
 	skip := 50
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// rule is a single search/replace pair, optionally backed by a compiled
+// regexp when the Replacer is running in regex mode.
+type rule struct {
+	search  string
+	replace string
+	re      *regexp.Regexp
+}
+
+// Replacer applies one or more search/replace rules to text in a single
+// pass. In literal mode it is backed by a strings.Replacer; in regex mode
+// the rules are compiled into one alternation so a file is scanned once
+// regardless of how many rules were loaded from -patterns.
+type Replacer struct {
+	regex    bool
+	literal  *strings.Replacer
+	rules    []rule
+	all      *regexp.Regexp
+	groupOf  []int
+	anchored bool
+}
+
+// NewReplacer builds a Replacer from search/replace pairs. When useRegex is
+// true, each search string is compiled as a Go regexp and replace may use
+// $1/${name} capture-group expansion.
+//
+// Alongside the literal/regex fast path used by Replace, NewReplacer always
+// compiles the rules into a combined alternation so replaceInLargeFile can
+// locate match spans when streaming a file in chunks.
+func NewReplacer(pairs [][2]string, useRegex bool) (*Replacer, error) {
+	rules := make([]rule, len(pairs))
+	parts := make([]string, len(pairs))
+	groupOf := make([]int, len(pairs))
+	nextGroup := 1
+
+	for i, p := range pairs {
+		pattern := p[0]
+		if !useRegex {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling pattern %q: %w", p[0], err)
+		}
+
+		rules[i] = rule{search: p[0], replace: p[1], re: re}
+		parts[i] = fmt.Sprintf("(%s)", pattern)
+		groupOf[i] = nextGroup
+		nextGroup += 1 + re.NumSubexp()
+	}
+
+	all, err := regexp.Compile(strings.Join(parts, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("compiling combined pattern: %w", err)
+	}
+
+	r := &Replacer{regex: useRegex, rules: rules, all: all, groupOf: groupOf}
+
+	if useRegex {
+		for _, p := range pairs {
+			if hasAnchor(p[0]) {
+				r.anchored = true
+				break
+			}
+		}
+	}
+
+	if !useRegex {
+		flat := make([]string, 0, len(pairs)*2)
+		for _, p := range pairs {
+			flat = append(flat, p[0], p[1])
+		}
+
+		r.literal = strings.NewReplacer(flat...)
+	}
+
+	return r, nil
+}
+
+// Replace applies every rule to s and returns the result.
+func (r *Replacer) Replace(s string) string {
+	if !r.regex {
+		return r.literal.Replace(s)
+	}
+
+	matches := r.all.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		b.WriteString(r.expand(s[m[0]:m[1]], m))
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+
+	return b.String()
+}
+
+// ReplaceCount is like Replace but also reports how many matches were
+// substituted, used for per-file reporting.
+func (r *Replacer) ReplaceCount(s string) (string, int) {
+	return r.Replace(s), len(r.all.FindAllStringIndex(s, -1))
+}
+
+// expand finds which rule owns a match, given the submatch index slice from
+// the combined alternation, and expands that rule's own capture groups
+// against the matched text. In literal mode the replacement is used as-is,
+// since literal replace text is never capture-group expanded.
+func (r *Replacer) expand(matched string, m []int) string {
+	for i, rl := range r.rules {
+		g := r.groupOf[i]
+		if m[2*g] == -1 {
+			continue
+		}
+
+		if !r.regex {
+			return rl.replace
+		}
+
+		return rl.re.ReplaceAllString(matched, rl.replace)
+	}
+
+	// Unreachable: every match came from one of the alternated groups.
+	return matched
+}
+
+// regexOverlapWindow is the trailing byte window replaceInLargeFile holds
+// back between blocks when running in regex mode. A regexp's source length
+// does not bound how many bytes a match can span (e.g. "a+"), so unlike
+// literal mode there is no exact figure to use; this is a best-effort
+// fallback, and a pattern that can match more than this many bytes across a
+// block boundary is not guaranteed to be caught.
+//
+// A second, unrelated limitation of the same streamed path: "^"/"$"
+// anchors bind to the start/end of whatever string FindAllStringSubmatchIndex
+// is given, which during streaming is one block, not the file as a whole.
+// There's no fixed-size window that fixes this the way regexOverlapWindow
+// works around unbounded match length, so anchored patterns are rejected
+// outright for large files instead of silently matching at every block
+// boundary; see hasAnchor and unsafeForLargeFiles.
+const regexOverlapWindow = 4096
+
+// hasAnchor reports whether pattern contains a "^" or "$" outside a
+// character class, i.e. an anchor to the start or end of the text rather
+// than a literal character. A backslash escapes the following rune, so
+// "\^" and "\$" don't count.
+func hasAnchor(pattern string) bool {
+	inClass := false
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '^', '$':
+			if !inClass {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// unsafeForLargeFiles reports whether r has a rule anchored with "^" or
+// "$". replaceInLargeFile can't honor such a rule correctly: the anchor
+// binds to the edges of whatever block it's matched against, not the real
+// start/end of the file, so it would otherwise match at every block
+// boundary instead of just the file's actual start/end.
+func (r *Replacer) unsafeForLargeFiles() bool {
+	return r.anchored
+}
+
+// overlap reports how many trailing bytes of an in-progress chunk might
+// still be the start of a match that continues into the next block, so
+// replaceInLargeFile knows how much to hold back between reads.
+func (r *Replacer) overlap() int {
+	if r.regex {
+		return regexOverlapWindow
+	}
+
+	maxLen := 0
+	for _, rl := range r.rules {
+		if len(rl.search) > maxLen {
+			maxLen = len(rl.search)
+		}
+	}
+
+	if maxLen == 0 {
+		return 0
+	}
+
+	return maxLen - 1
+}
+
+// chunk applies every rule to data, a block read from a large file plus
+// whatever tail was held back from the previous block, and splits the
+// result into the part that is safe to flush now and the raw remainder to
+// prepend to the next block. replacements reports how many matches were
+// applied in this call, so callers can skip rewriting a file that never
+// matched and can report a total count.
+//
+// Unless atEOF, any match starting within the trailing overlap() bytes of
+// data is deferred rather than resolved: it (and everything before it
+// still pending) is returned as rest so the next call sees it combined
+// with the following block. This is what keeps a match from being split
+// by the arbitrary point a block happens to end on.
+//
+// uncertain counts resolved regex matches that run all the way to the end
+// of data: regexOverlapWindow is a fixed-size guess at how far a match can
+// span, not a true bound, so a match like "a+" over a run longer than the
+// window can still be cut short at this block's edge. Those matches are
+// resolved as-is rather than failing, but uncertain lets callers surface
+// that the result may be wrong instead of staying silent about it.
+func (r *Replacer) chunk(data []byte, atEOF bool) (flush, rest []byte, replacements, uncertain int) {
+	if atEOF {
+		out, n := r.ReplaceCount(string(data))
+		return []byte(out), nil, n, 0
+	}
+
+	cut := len(data) - r.overlap()
+	if cut <= 0 {
+		return nil, data, 0, 0
+	}
+
+	s := string(data)
+	matches := r.all.FindAllStringSubmatchIndex(s, -1)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[0] >= cut {
+			break
+		}
+
+		if r.regex && m[1] == len(s) {
+			uncertain++
+		}
+
+		b.WriteString(s[last:m[0]])
+		b.WriteString(r.expand(s[m[0]:m[1]], m))
+		last = m[1]
+		replacements++
+	}
+
+	if last < cut {
+		b.WriteString(s[last:cut])
+		last = cut
+	}
+
+	return []byte(b.String()), []byte(s[last:]), replacements, uncertain
+}
+
+// loadPatterns reads tab-separated "search\treplace" pairs from path, one
+// per line. Blank lines and lines starting with '#' are skipped.
+func loadPatterns(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairs [][2]string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed pattern line %q: expected search\\treplace", line)
+		}
+
+		pairs = append(pairs, [2]string{parts[0], parts[1]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReplacerLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    [][2]string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single pair",
+			pairs:    [][2]string{{"foo", "bar"}},
+			input:    "foo baz foo",
+			expected: "bar baz bar",
+		},
+		{
+			name:     "multiple pairs applied in one pass",
+			pairs:    [][2]string{{"foo", "bar"}, {"bar", "baz"}},
+			input:    "foo bar",
+			expected: "bar baz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReplacer(tt.pairs, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := r.Replace(tt.input); got != tt.expected {
+				t.Errorf("expected %q but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReplacerRegex(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    [][2]string
+		input    string
+		expected string
+	}{
+		{
+			name:     "capture group expansion",
+			pairs:    [][2]string{{`(\w+)@(\w+)\.com`, "$2:$1"}},
+			input:    "user@example.com",
+			expected: "example:user",
+		},
+		{
+			name:     "named capture group expansion",
+			pairs:    [][2]string{{`(?P<user>\w+)@(?P<host>\w+)\.com`, "${host}:${user}"}},
+			input:    "user@example.com",
+			expected: "example:user",
+		},
+		{
+			name:     "multiple regex rules in one pass",
+			pairs:    [][2]string{{`foo(\d+)`, "F$1"}, {`bar(\d+)`, "B$1"}},
+			input:    "foo1 bar2 foo3",
+			expected: "F1 B2 F3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReplacer(tt.pairs, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := r.Replace(tt.input); got != tt.expected {
+				t.Errorf("expected %q but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewReplacerInvalidRegex(t *testing.T) {
+	if _, err := NewReplacer([][2]string{{"(", "x"}}, true); err == nil {
+		t.Fatal("expected an error for an invalid regexp")
+	}
+}
+
+func TestHasAnchor(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    bool
+	}{
+		{name: "start anchor", pattern: "^foo", want: true},
+		{name: "end anchor", pattern: "foo$", want: true},
+		{name: "multiline flag with anchors", pattern: "(?m)^foo$", want: true},
+		{name: "no anchor", pattern: `foo\d+`, want: false},
+		{name: "escaped anchors are literal", pattern: `\^foo\$`, want: false},
+		{name: "negated character class is not an anchor", pattern: "[^abc]", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasAnchor(tt.pattern); got != tt.want {
+				t.Errorf("hasAnchor(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplacerUnsafeForLargeFiles(t *testing.T) {
+	anchored, err := NewReplacer([][2]string{{"^foo", "bar"}}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !anchored.unsafeForLargeFiles() {
+		t.Error("a pattern anchored with ^ should be unsafe for large files")
+	}
+
+	plain, err := NewReplacer([][2]string{{"foo", "bar"}}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plain.unsafeForLargeFiles() {
+		t.Error("an unanchored pattern should be safe for large files")
+	}
+
+	literal, err := NewReplacer([][2]string{{"^foo", "bar"}}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if literal.unsafeForLargeFiles() {
+		t.Error("literal mode quotes ^ as a literal character, so it should never be unsafe")
+	}
+}
+
+func TestLoadPatterns(t *testing.T) {
+	f, err := os.CreateTemp("", "patterns")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString("foo\tbar\n# comment\n\nbaz\tqux\n"); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	f.Close()
+
+	pairs, err := loadPatterns(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][2]string{{"foo", "bar"}, {"baz", "qux"}}
+	if len(pairs) != len(expected) {
+		t.Fatalf("expected %d pairs but got %d: %v", len(expected), len(pairs), pairs)
+	}
+
+	for i, p := range expected {
+		if pairs[i] != p {
+			t.Errorf("expected pair %v but got %v", p, pairs[i])
+		}
+	}
+}
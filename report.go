@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// FileResult records the outcome of processing one file, or a walk failure
+// not tied to a specific one (Path empty in that case).
+type FileResult struct {
+	Path         string        `json:"path"`
+	BytesScanned int64         `json:"bytesScanned"`
+	Replacements int           `json:"replacements"`
+	Duration     time.Duration `json:"duration"`
+	Error        string        `json:"error,omitempty"`
+
+	// UncertainMatches counts resolved matches that replaceInLargeFile's
+	// block streaming flagged as possibly cut short at a block boundary
+	// (see regexOverlapWindow). Zero for files small enough to be
+	// processed in one piece, where this can't happen.
+	UncertainMatches int `json:"uncertainMatches,omitempty"`
+}
+
+// Report collects FileResults as the walker and worker pools produce them
+// concurrently. A mutex is enough here since adds are small and infrequent
+// relative to the I/O each file does.
+type Report struct {
+	mu      sync.Mutex
+	results []FileResult
+}
+
+func (r *Report) add(res FileResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, res)
+}
+
+// addError records a failure that isn't the outcome of processing a single
+// file to completion, e.g. a walk error or a context cancellation.
+func (r *Report) addError(path string, err error) {
+	r.add(FileResult{Path: path, Error: err.Error()})
+}
+
+// Summary is the aggregated view of a Report that -report renders.
+type Summary struct {
+	FilesProcessed    int          `json:"filesProcessed"`
+	FilesErrored      int          `json:"filesErrored"`
+	TotalReplacements int          `json:"totalReplacements"`
+	TotalBytesScanned int64        `json:"totalBytesScanned"`
+	TotalUncertain    int          `json:"totalUncertain,omitempty"`
+	Results           []FileResult `json:"results"`
+}
+
+func (r *Report) summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Summary{Results: append([]FileResult(nil), r.results...)}
+	for _, res := range r.results {
+		s.FilesProcessed++
+		if res.Error != "" {
+			s.FilesErrored++
+		}
+		s.TotalReplacements += res.Replacements
+		s.TotalBytesScanned += res.BytesScanned
+		s.TotalUncertain += res.UncertainMatches
+	}
+
+	return s
+}
+
+// write renders the summary to w as "json" or "text" (the default for any
+// other value).
+func (s Summary) write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	fmt.Fprintf(w, "processed %d file(s), %d error(s), %d replacement(s), %d byte(s) scanned\n",
+		s.FilesProcessed, s.FilesErrored, s.TotalReplacements, s.TotalBytesScanned)
+	if s.TotalUncertain > 0 {
+		fmt.Fprintf(w, "warning: %d replacement(s) may be incorrect, cut short at a large-file block boundary\n", s.TotalUncertain)
+	}
+
+	for _, res := range s.Results {
+		if res.Error != "" {
+			fmt.Fprintf(w, "  %s: error: %s\n", res.Path, res.Error)
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s: %d replacement(s), %d byte(s), %s\n", res.Path, res.Replacements, res.BytesScanned, res.Duration)
+		if res.UncertainMatches > 0 {
+			fmt.Fprintf(w, "    warning: %d of these may be incorrect, cut short at a block boundary\n", res.UncertainMatches)
+		}
+	}
+
+	return nil
+}
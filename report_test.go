@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReportSummary(t *testing.T) {
+	r := &Report{}
+	r.add(FileResult{Path: "a.txt", BytesScanned: 10, Replacements: 2})
+	r.add(FileResult{Path: "b.txt", BytesScanned: 5})
+	r.addError("c.txt", errString("boom"))
+
+	s := r.summary()
+
+	if s.FilesProcessed != 3 {
+		t.Errorf("expected 3 files processed, got %d", s.FilesProcessed)
+	}
+	if s.FilesErrored != 1 {
+		t.Errorf("expected 1 file errored, got %d", s.FilesErrored)
+	}
+	if s.TotalReplacements != 2 {
+		t.Errorf("expected 2 total replacements, got %d", s.TotalReplacements)
+	}
+	if s.TotalBytesScanned != 15 {
+		t.Errorf("expected 15 total bytes scanned, got %d", s.TotalBytesScanned)
+	}
+}
+
+func TestReportSummaryUncertainMatches(t *testing.T) {
+	r := &Report{}
+	r.add(FileResult{Path: "a.txt", Replacements: 2, UncertainMatches: 1})
+
+	s := r.summary()
+
+	if s.TotalUncertain != 1 {
+		t.Errorf("expected 1 total uncertain match, got %d", s.TotalUncertain)
+	}
+
+	var buf bytes.Buffer
+	if err := s.write(&buf, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "1 replacement(s) may be incorrect") {
+		t.Errorf("expected text output to warn about uncertain matches, got %q", buf.String())
+	}
+}
+
+func TestSummaryWriteJSON(t *testing.T) {
+	s := Summary{
+		FilesProcessed: 1,
+		Results:        []FileResult{{Path: "a.txt", Replacements: 1}},
+	}
+
+	var buf bytes.Buffer
+	if err := s.write(&buf, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got Summary
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	if got.FilesProcessed != 1 || len(got.Results) != 1 || got.Results[0].Path != "a.txt" {
+		t.Errorf("unexpected decoded summary: %+v", got)
+	}
+}
+
+func TestSummaryWriteText(t *testing.T) {
+	s := Summary{
+		FilesProcessed: 1,
+		FilesErrored:   1,
+		Results:        []FileResult{{Path: "a.txt", Error: "boom"}},
+	}
+
+	var buf bytes.Buffer
+	if err := s.write(&buf, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "a.txt: error: boom") {
+		t.Errorf("expected text output to mention the error, got %q", buf.String())
+	}
+}
+
+// errString is a tiny helper so tests can build a plain error without
+// importing the errors package just for this.
+type errString string
+
+func (e errString) Error() string { return string(e) }
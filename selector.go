@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Selector decides which files and directories a walk should visit. It is a
+// pure decision-maker: walkDir feeds it the paths, depths, and file info it
+// observes as it descends, and Selector never touches the filesystem itself
+// except to read .gitignore files in EnterDir. That keeps it independently
+// unit-testable against an in-memory tree, without needing a real walk.
+type Selector struct {
+	includes         []string
+	excludes         []string
+	followSymlinks   bool
+	maxDepth         int // negative means unlimited
+	respectGitignore bool
+	allowBinary      bool
+
+	ignoreStack [][]ignoreRule
+}
+
+// NewSelector builds a Selector from the -include/-exclude/-follow-symlinks/
+// -max-depth/-respect-gitignore/-binary flags. maxDepth < 0 means unlimited.
+func NewSelector(includes, excludes []string, followSymlinks bool, maxDepth int, respectGitignore, allowBinary bool) *Selector {
+	return &Selector{
+		includes:         includes,
+		excludes:         excludes,
+		followSymlinks:   followSymlinks,
+		maxDepth:         maxDepth,
+		respectGitignore: respectGitignore,
+		allowBinary:      allowBinary,
+	}
+}
+
+// SkipSymlink reports whether a symlink should be skipped rather than
+// followed, per -follow-symlinks.
+func (s *Selector) SkipSymlink() bool {
+	return !s.followSymlinks
+}
+
+// TooDeep reports whether depth, the number of directories below the walk
+// root a subdirectory sits at, exceeds -max-depth.
+func (s *Selector) TooDeep(depth int) bool {
+	return s.maxDepth >= 0 && depth > s.maxDepth
+}
+
+// Matches reports whether relPath, slash-separated and relative to the walk
+// root, should be processed: it isn't ignored by a .gitignore rule pushed
+// via EnterDir, doesn't match an -exclude glob, and matches an -include
+// glob if any were given.
+func (s *Selector) Matches(relPath string, isDir bool) bool {
+	if s.ignored(relPath, isDir) {
+		return false
+	}
+
+	if matchesAny(s.excludes, relPath) {
+		return false
+	}
+
+	if len(s.includes) > 0 && !matchesAny(s.includes, relPath) {
+		return false
+	}
+
+	return true
+}
+
+// ShouldDescend reports whether relDir, a directory relative to the walk
+// root, should be recursed into. Unlike Matches, it omits the -include
+// check: -include selects which files get processed, and a directory
+// whose own name doesn't match an -include glob can still hold files that
+// do (e.g. -include '*.go' must still descend into every subdirectory to
+// find them). Descent is gated only by .gitignore rules and -exclude.
+func (s *Selector) ShouldDescend(relDir string) bool {
+	if s.ignored(relDir, true) {
+		return false
+	}
+
+	return !matchesAny(s.excludes, relDir)
+}
+
+// matchesAny reports whether relPath matches any of patterns. Alongside
+// matching the full relPath, each pattern is also tried against relPath's
+// base name alone, as a convenience: a pattern with no "/" in it, like
+// "*.go" or "foo.go", matches at any depth rather than only at the walk
+// root. A pattern that itself contains a "/", like "vendor/foo.go", is
+// unaffected by this fallback (it has no "/" to match against a bare base
+// name) and only ever matches relPath in full, so it stays anchored to
+// that path.
+func matchesAny(patterns []string, relPath string) bool {
+	base := path.Base(relPath)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, relPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnterDir reads dir's .gitignore, if -respect-gitignore is set and one
+// exists, and pushes its rules onto the ignore stack, scoped to relDir
+// (dir's path relative to the walk root). Call LeaveDir once dir's subtree
+// has been fully visited, so its rules stop applying to the rest of the
+// walk.
+func (s *Selector) EnterDir(fs afero.Fs, dir, relDir string) error {
+	if !s.respectGitignore {
+		s.ignoreStack = append(s.ignoreStack, nil)
+		return nil
+	}
+
+	rules, err := readGitignore(fs, dir, relDir)
+	if err != nil {
+		return err
+	}
+
+	s.ignoreStack = append(s.ignoreStack, rules)
+
+	return nil
+}
+
+// LeaveDir pops the rules pushed by the matching EnterDir.
+func (s *Selector) LeaveDir() {
+	s.ignoreStack = s.ignoreStack[:len(s.ignoreStack)-1]
+}
+
+// ignored reports whether relPath is excluded by a .gitignore rule
+// currently on the stack. Like git itself, the last matching rule across
+// every applicable .gitignore wins, so a later "!pattern" can re-include
+// something an earlier pattern excluded.
+func (s *Selector) ignored(relPath string, isDir bool) bool {
+	ignore := false
+
+	for _, rules := range s.ignoreStack {
+		for _, r := range rules {
+			if r.match(relPath, isDir) {
+				ignore = !r.negate
+			}
+		}
+	}
+
+	return ignore
+}
+
+// ignoreRule is one line of a .gitignore, scoped to the directory it came
+// from.
+type ignoreRule struct {
+	base     string // dir's path relative to the walk root ("" for the root)
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// match reports whether relPath (relative to the walk root) matches the
+// rule. It implements a practical subset of gitignore syntax: comments,
+// blank lines, "!" negation, a trailing "/" for directory-only patterns,
+// and a leading or embedded "/" to anchor a pattern to base instead of
+// letting it match at any depth beneath it. It does not special-case "**".
+func (r ignoreRule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel, ok := relativeTo(r.base, relPath)
+	if !ok {
+		return false
+	}
+
+	if r.anchored {
+		ok, _ := path.Match(r.pattern, rel)
+		return ok
+	}
+
+	ok, _ = path.Match(r.pattern, path.Base(rel))
+	return ok
+}
+
+// relativeTo reports relPath's path relative to base, both slash-separated
+// and relative to the walk root, and whether relPath is under base at all.
+func relativeTo(base, relPath string) (string, bool) {
+	if base == "" {
+		return relPath, true
+	}
+
+	if relPath == base {
+		return "", true
+	}
+
+	prefix := base + "/"
+	if !strings.HasPrefix(relPath, prefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(relPath, prefix), true
+}
+
+// readGitignore parses dir/.gitignore, if present, into rules scoped to
+// relDir.
+func readGitignore(fs afero.Fs, dir, relDir string) ([]ignoreRule, error) {
+	f, err := fs.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: relDir}
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		rule.anchored = strings.HasPrefix(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// binarySniffLen is how much of a file isBinary reads to look for a NUL
+// byte, the same heuristic git uses to decide a diff is binary.
+const binarySniffLen = 8 * 1024
+
+// isBinary reports whether the first binarySniffLen bytes of fs's file at
+// path contain a NUL byte.
+func isBinary(fs afero.Fs, path string) (bool, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+
+	n, err := f.Read(buf)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	return bytes.IndexByte(buf[:n], 0) != -1, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestSelectorIncludeExclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes []string
+		excludes []string
+		relPath  string
+		want     bool
+	}{
+		{
+			name:    "no patterns matches everything",
+			relPath: "main.go",
+			want:    true,
+		},
+		{
+			name:     "include glob matches",
+			includes: []string{"*.go"},
+			relPath:  "main.go",
+			want:     true,
+		},
+		{
+			name:     "include glob rejects non-match",
+			includes: []string{"*.go"},
+			relPath:  "README.md",
+			want:     false,
+		},
+		{
+			name:     "include matches nested path via basename",
+			includes: []string{"*.go"},
+			relPath:  "pkg/sub/main.go",
+			want:     true,
+		},
+		{
+			name:     "exclude wins over include",
+			includes: []string{"*.go"},
+			excludes: []string{"*_test.go"},
+			relPath:  "main_test.go",
+			want:     false,
+		},
+		{
+			name:     "exclude matches full relative path",
+			excludes: []string{"vendor/*"},
+			relPath:  "vendor/lib.go",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSelector(tt.includes, tt.excludes, false, -1, false, false)
+
+			if got := s.Matches(tt.relPath, false); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.relPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorShouldDescend(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes []string
+		excludes []string
+		relDir   string
+		want     bool
+	}{
+		{
+			name:     "include glob doesn't block descent into non-matching dir",
+			includes: []string{"*.go"},
+			relDir:   "pkg/sub",
+			want:     true,
+		},
+		{
+			name:     "exclude still blocks descent",
+			excludes: []string{"vendor"},
+			relDir:   "vendor",
+			want:     false,
+		},
+		{
+			name:     "exclude basename fallback blocks descent at any depth",
+			excludes: []string{"vendor"},
+			relDir:   "pkg/vendor",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSelector(tt.includes, tt.excludes, false, -1, false, false)
+
+			if got := s.ShouldDescend(tt.relDir); got != tt.want {
+				t.Errorf("ShouldDescend(%q) = %v, want %v", tt.relDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnyBasenameFallbackPrecedence(t *testing.T) {
+	// A slash-free pattern, like "foo.go", also matches via the basename
+	// fallback at any depth, not just a relPath of exactly "foo.go" rooted
+	// at the walk root.
+	if !matchesAny([]string{"foo.go"}, "vendor/foo.go") {
+		t.Error("foo.go should also match vendor/foo.go via the basename fallback")
+	}
+
+	// A pattern that itself contains a "/", like "vendor/foo.go", has no
+	// "/" in relPath's base name to match against, so the fallback can't
+	// widen it: it stays anchored to that exact relative path.
+	if matchesAny([]string{"vendor/foo.go"}, "other/vendor/foo.go") {
+		t.Error("vendor/foo.go should not match other/vendor/foo.go: it is anchored, not a basename pattern")
+	}
+}
+
+func TestSelectorMaxDepth(t *testing.T) {
+	s := NewSelector(nil, nil, false, 1, false, false)
+
+	if s.TooDeep(0) {
+		t.Error("depth 0 should not be too deep")
+	}
+	if s.TooDeep(1) {
+		t.Error("depth 1 should not be too deep with max-depth 1")
+	}
+	if !s.TooDeep(2) {
+		t.Error("depth 2 should be too deep with max-depth 1")
+	}
+
+	unlimited := NewSelector(nil, nil, false, -1, false, false)
+	if unlimited.TooDeep(100) {
+		t.Error("max-depth -1 should never be too deep")
+	}
+}
+
+func TestSelectorSymlinkPolicy(t *testing.T) {
+	if !NewSelector(nil, nil, false, -1, false, false).SkipSymlink() {
+		t.Error("symlinks should be skipped by default")
+	}
+	if NewSelector(nil, nil, true, -1, false, false).SkipSymlink() {
+		t.Error("-follow-symlinks should stop symlinks from being skipped")
+	}
+}
+
+func TestSelectorGitignore(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(fs, "/root/.gitignore", []byte("*.log\nbuild/\n!keep.log\n"), 0644); err != nil {
+		t.Fatalf("failed to write .gitignore: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/root/sub/.gitignore", []byte("/local.txt\n"), 0644); err != nil {
+		t.Fatalf("failed to write nested .gitignore: %v", err)
+	}
+
+	s := NewSelector(nil, nil, false, -1, true, false)
+
+	if err := s.EnterDir(fs, "/root", ""); err != nil {
+		t.Fatalf("EnterDir(root) failed: %v", err)
+	}
+	defer s.LeaveDir()
+
+	if s.Matches("keep.log", false) == false {
+		t.Error("keep.log should be re-included by the negated pattern")
+	}
+	if s.Matches("debug.log", false) {
+		t.Error("debug.log should be ignored by *.log")
+	}
+	if s.Matches("build", true) {
+		t.Error("build/ should be ignored as a directory-only pattern")
+	}
+
+	if err := s.EnterDir(fs, "/root/sub", "sub"); err != nil {
+		t.Fatalf("EnterDir(sub) failed: %v", err)
+	}
+
+	if s.Matches("sub/local.txt", false) {
+		t.Error("sub/local.txt should be ignored by the nested .gitignore's anchored pattern")
+	}
+	if !s.Matches("other/local.txt", false) {
+		t.Error("local.txt anchored under sub/ should not apply to other/local.txt")
+	}
+	if s.Matches("sub/debug.log", false) {
+		t.Error("sub/debug.log should still be ignored by the root's *.log pattern")
+	}
+
+	s.LeaveDir()
+
+	if s.Matches("sub/local.txt", false) == false {
+		t.Error("sub/local.txt should no longer be ignored once its .gitignore's scope is left")
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	if err := afero.WriteFile(fs, "/text.txt", []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/bin.dat", []byte("hello\x00world"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	bin, err := isBinary(fs, "/text.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bin {
+		t.Error("text.txt should not be detected as binary")
+	}
+
+	bin, err = isBinary(fs, "/bin.dat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bin {
+		t.Error("bin.dat should be detected as binary")
+	}
+}